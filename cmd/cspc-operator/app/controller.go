@@ -0,0 +1,294 @@
+/*
+Copyright 2018 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+
+	clientset "github.com/openebs/maya/pkg/client/generated/clientset/versioned"
+	informers "github.com/openebs/maya/pkg/client/generated/informers/externalversions"
+	listers "github.com/openebs/maya/pkg/client/generated/listers/openebs.io/v1alpha1"
+	ndmclientset "github.com/openebs/maya/pkg/client/generated/openebs.io/ndm/v1alpha1/clientset/internalclientset"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Controller reconciles CStorPoolClusters. It is assembled by
+// ControllerBuilder so that its dependencies can be wired in independently
+// of one another.
+type Controller struct {
+	kubeclientset kubernetes.Interface
+	clientset     clientset.Interface
+	ndmclientset  ndmclientset.Interface
+
+	cspcListers []listers.CStorPoolClusterLister
+	cspcSynced  []cache.InformerSynced
+
+	recorder  record.EventRecorder
+	workqueue workqueue.RateLimitingInterface
+
+	dynamicInformers *dynamicInformerManager
+}
+
+// ControllerBuilder accumulates the dependencies Controller needs before
+// Build() assembles them. withCSPCSynced/withCSPCLister/withEventHandler can
+// each be called once per watched namespace; the same underlying factory is
+// only wired up once even if all three are called with it, and every
+// distinct factory passed in is kept, so multi-namespace scoping ends up
+// watching every configured namespace instead of only the last one.
+type ControllerBuilder struct {
+	kubeclientset kubernetes.Interface
+	clientset     clientset.Interface
+	ndmclientset  ndmclientset.Interface
+	recorder      record.EventRecorder
+
+	cspcFactories []informers.SharedInformerFactory
+
+	rateLimiter      workqueue.RateLimiter
+	dynamicInformers *dynamicInformerManager
+}
+
+// NewControllerBuilder returns an empty ControllerBuilder.
+func NewControllerBuilder() *ControllerBuilder {
+	return &ControllerBuilder{}
+}
+
+func (b *ControllerBuilder) withKubeClient(kubeclientset kubernetes.Interface) *ControllerBuilder {
+	b.kubeclientset = kubeclientset
+	return b
+}
+
+func (b *ControllerBuilder) withOpenEBSClient(clientset clientset.Interface) *ControllerBuilder {
+	b.clientset = clientset
+	return b
+}
+
+func (b *ControllerBuilder) withNDMClient(ndmclientset ndmclientset.Interface) *ControllerBuilder {
+	b.ndmclientset = ndmclientset
+	return b
+}
+
+// withRecorder sets the recorder the controller uses to emit Kubernetes
+// events. Callers should pass the same recorder used for leader election
+// (see newEventRecorder) so all events for this process are sinked through
+// one broadcaster under one Component label.
+func (b *ControllerBuilder) withRecorder(recorder record.EventRecorder) *ControllerBuilder {
+	b.recorder = recorder
+	return b
+}
+
+// withCSPCSynced, withCSPCLister and withEventHandler each register the
+// given factory's CSPC informer for cache-sync tracking, listing, and event
+// handling respectively. They're kept as separate calls (matching how the
+// caller reasons about each concern) but all accumulate into the same
+// deduplicated factory set, so calling all three with the same factory wires
+// it up exactly once.
+func (b *ControllerBuilder) withCSPCSynced(factory informers.SharedInformerFactory) *ControllerBuilder {
+	return b.addCSPCFactory(factory)
+}
+
+func (b *ControllerBuilder) withCSPCLister(factory informers.SharedInformerFactory) *ControllerBuilder {
+	return b.addCSPCFactory(factory)
+}
+
+func (b *ControllerBuilder) withEventHandler(factory informers.SharedInformerFactory) *ControllerBuilder {
+	return b.addCSPCFactory(factory)
+}
+
+func (b *ControllerBuilder) addCSPCFactory(factory informers.SharedInformerFactory) *ControllerBuilder {
+	for _, existing := range b.cspcFactories {
+		if existing == factory {
+			return b
+		}
+	}
+	b.cspcFactories = append(b.cspcFactories, factory)
+	return b
+}
+
+// withDynamicInformerFactory wires in the manager responsible for lazily
+// starting informers for GVRs discovered at runtime from a CSPC's spec.
+func (b *ControllerBuilder) withDynamicInformerFactory(dynamicInformers *dynamicInformerManager) *ControllerBuilder {
+	b.dynamicInformers = dynamicInformers
+	return b
+}
+
+// withWorkqueueRateLimiting sets the rate limiter backing the controller's
+// workqueue. A nil limiter falls back to workqueue.DefaultControllerRateLimiter().
+func (b *ControllerBuilder) withWorkqueueRateLimiting(rateLimiter workqueue.RateLimiter) *ControllerBuilder {
+	b.rateLimiter = rateLimiter
+	return b
+}
+
+// Build assembles the Controller from the accumulated options.
+func (b *ControllerBuilder) Build() (*Controller, error) {
+	rateLimiter := b.rateLimiter
+	if rateLimiter == nil {
+		rateLimiter = workqueue.DefaultControllerRateLimiter()
+	}
+
+	c := &Controller{
+		kubeclientset:    b.kubeclientset,
+		clientset:        b.clientset,
+		ndmclientset:     b.ndmclientset,
+		recorder:         b.recorder,
+		workqueue:        workqueue.NewNamedRateLimitingQueue(rateLimiter, "cspc"),
+		dynamicInformers: b.dynamicInformers,
+	}
+
+	for _, factory := range b.cspcFactories {
+		cspcInformer := factory.Openebs().V1alpha1().CStorPoolClusters()
+		c.cspcSynced = append(c.cspcSynced, cspcInformer.Informer().HasSynced)
+		c.cspcListers = append(c.cspcListers, cspcInformer.Lister())
+		cspcInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.enqueueCSPC,
+			UpdateFunc: func(old, new interface{}) { c.enqueueCSPC(new) },
+			DeleteFunc: c.enqueueCSPC,
+		})
+	}
+
+	if c.dynamicInformers != nil {
+		// Forward discovered-GVR informer events into this controller's own
+		// workqueue instead of a second, disconnected one, so syncHandler
+		// handles them the same way it handles CSPC events.
+		c.dynamicInformers.BindQueue(c.workqueue)
+	}
+
+	return c, nil
+}
+
+// enqueueCSPC converts a CSPC object into a namespace/name workqueue key.
+func (c *Controller) enqueueCSPC(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.workqueue.Add(key)
+}
+
+// Run starts threadiness workers processing the workqueue until stopCh is
+// closed.
+func (c *Controller) Run(threadiness int, stopCh <-chan struct{}) error {
+	defer utilruntime.HandleCrash()
+	defer c.workqueue.ShutDown()
+
+	klog.Info("Starting CSPC controller")
+
+	if !cache.WaitForCacheSync(stopCh, c.cspcSynced...) {
+		setInformerSynced("cspc", false)
+		return errors.New("failed to wait for CSPC informer caches to sync")
+	}
+	setInformerSynced("cspc", true)
+
+	klog.Infof("Starting %d workers", threadiness)
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	klog.Info("Started workers")
+	<-stopCh
+	klog.Info("Shutting down workers")
+
+	return nil
+}
+
+func (c *Controller) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+// processNextWorkItem pops a single key off the workqueue, reconciles it via
+// syncHandler, and records the outcome for both the reconcile metrics and
+// the /readyz stall detection, both of which need signal from every real
+// reconcile, not just the one at startup.
+func (c *Controller) processNextWorkItem() bool {
+	obj, shutdown := c.workqueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.workqueue.Done(obj)
+
+	key, ok := obj.(string)
+	if !ok {
+		c.workqueue.Forget(obj)
+		utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+		return true
+	}
+
+	start := time.Now()
+	err := c.syncHandler(key)
+	observeReconcile(key, start, err)
+
+	if err != nil {
+		c.workqueue.AddRateLimited(key)
+		utilruntime.HandleError(fmt.Errorf("error syncing %q: %v, requeuing", key, err))
+		return true
+	}
+
+	c.workqueue.Forget(obj)
+	recordReconcile(time.Now())
+	return true
+}
+
+// syncHandler reconciles a single CSPC, identified by its namespace/name
+// key. It also discovers any CR types the CSPC's spec references and makes
+// sure informers are running for them.
+func (c *Controller) syncHandler(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return errors.Wrapf(err, "invalid resource key %q", key)
+	}
+	klog.V(4).Infof("syncing CSPC %s/%s", namespace, name)
+
+	if c.dynamicInformers != nil {
+		if gvrs := c.discoverReferencedGVRs(namespace, name); len(gvrs) > 0 {
+			c.dynamicInformers.StartInformersFor(gvrs)
+		}
+	}
+
+	return nil
+}
+
+// blockDeviceClaimGVK is the one CR type every CSPC is known to reference
+// today (for provisioning the block devices backing its pools). Custom pool
+// policies and other third-party CRs a CSPC's spec may reference aren't
+// walked yet because the CSPC spec type (pkg/apis/openebs.io/v1alpha1) isn't
+// part of this tree; once that field mapping is added, this is the function
+// it plugs into.
+var blockDeviceClaimGVK = schema.GroupVersionKind{Group: "openebs.io", Version: "v1alpha1", Kind: "BlockDeviceClaim"}
+
+// discoverReferencedGVRs resolves the GVRs of CR types referenced from the
+// named CSPC's spec, using the dynamic informer manager's cached REST
+// mapper. GVKs that don't resolve (e.g. the CRD isn't installed in this
+// cluster) are skipped rather than failing the whole reconcile.
+func (c *Controller) discoverReferencedGVRs(namespace, name string) []schema.GroupVersionResource {
+	gvr, err := c.dynamicInformers.resolveGVR(blockDeviceClaimGVK)
+	if err != nil {
+		klog.Warningf("could not resolve %s referenced by CSPC %s/%s: %v", blockDeviceClaimGVK, namespace, name, err)
+		return nil
+	}
+	return []schema.GroupVersionResource{gvr}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+)
+
+// dynamicInformerManager lazily starts informers for GVRs discovered at
+// runtime (e.g. BlockDeviceClaim, custom pool policies, or third-party CRs
+// referenced by a CSPC's spec) so the operator does not need to be
+// recompiled whenever a new referenced type shows up. This mirrors the
+// pattern used by kube-controller-manager's resource-quota controller to
+// discover and watch arbitrary resources.
+type dynamicInformerManager struct {
+	factory dynamicinformer.DynamicSharedInformerFactory
+	mapper  *restmapper.DeferredDiscoveryRESTMapper
+	queue   workqueue.RateLimitingInterface
+
+	mtx     sync.Mutex
+	started map[schema.GroupVersionResource]bool
+	stopCh  <-chan struct{}
+}
+
+// newDynamicInformerManager builds the dynamic client and informer factory
+// used to watch arbitrary CR types, along with a discovery-backed REST
+// mapper that caches GVK->GVR resolutions. The manager starts out with its
+// own standalone workqueue so it's usable before a controller exists; once
+// BindQueue is called (ControllerBuilder.Build does this), discovered
+// informers forward their events into the controller's real workqueue
+// instead of the standalone one.
+func newDynamicInformerManager(cfg *rest.Config, resyncInterval time.Duration, stopCh <-chan struct{}) (*dynamicInformerManager, error) {
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building dynamic clientset")
+	}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error building discovery client")
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resyncInterval)
+
+	return &dynamicInformerManager{
+		factory: factory,
+		mapper:  mapper,
+		queue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "cspc-dynamic-informers"),
+		started: make(map[schema.GroupVersionResource]bool),
+		stopCh:  stopCh,
+	}, nil
+}
+
+// Queue returns the workqueue that dynamically-discovered informers
+// forward keys into.
+func (m *dynamicInformerManager) Queue() workqueue.RateLimitingInterface {
+	return m.queue
+}
+
+// BindQueue redirects future events from dynamically-started informers
+// into q instead of the manager's own standalone queue, so a single
+// controller reconcile loop drains both the typed CSPC informer and every
+// dynamically-discovered one.
+func (m *dynamicInformerManager) BindQueue(q workqueue.RateLimitingInterface) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.queue = q
+}
+
+// resolveGVR resolves a GroupVersionKind (as referenced e.g. from a CSPC
+// pool policy or a third-party CR) to its GroupVersionResource, using the
+// cached REST mapper so repeated lookups for the same kind don't hit
+// discovery again.
+func (m *dynamicInformerManager) resolveGVR(gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+	mapping, err := m.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return schema.GroupVersionResource{}, errors.Wrapf(err, "error resolving GVR for %s", gvk)
+	}
+	return mapping.Resource, nil
+}
+
+// StartInformersFor spins up an informer for every GVR in gvrs that isn't
+// already running, forwarding add/update/delete events into the existing
+// workqueue (keyed the same way as the typed CSPC informer) so the
+// controller's reconcile loop handles them uniformly. Informers already
+// started are left untouched, so this is safe to call repeatedly as new
+// GVRs are discovered from CSPC specs at runtime.
+func (m *dynamicInformerManager) StartInformersFor(gvrs []schema.GroupVersionResource) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for _, gvr := range gvrs {
+		if m.started[gvr] {
+			continue
+		}
+
+		informer := m.factory.ForResource(gvr).Informer()
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    m.enqueue,
+			UpdateFunc: func(old, new interface{}) { m.enqueue(new) },
+			DeleteFunc: m.enqueue,
+		})
+
+		m.started[gvr] = true
+		klog.Infof("started dynamic informer for %s", gvr)
+	}
+
+	m.factory.Start(m.stopCh)
+}
+
+func (m *dynamicInformerManager) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("error computing key for dynamic informer object: %v", err)
+		return
+	}
+	m.queue.Add(key)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog"
+)
+
+var (
+	healthAddr = flag.String("health-addr", getStringFromEnv("HEALTH_ADDR", ":8081"),
+		"Address the operator's /healthz and /readyz endpoints bind to")
+	reconcileStallWindow = flag.Duration("reconcile-stall-window", getDurationFromEnv("RECONCILE_STALL_WINDOW", 5*time.Minute),
+		"How long the workqueue may go without a successful reconcile before /readyz reports unready")
+)
+
+// healthState tracks the bits of operator state that gate /healthz and
+// /readyz: whether the leader-election loop is healthy, whether this
+// replica currently holds the lease, whether the informer caches have
+// synced, and when the workqueue last made progress.
+type healthState struct {
+	leaderElectionHealthy int32
+	isLeader              int32
+	cachesSynced          int32
+	lastReconcileUnix     int64
+}
+
+var health = &healthState{leaderElectionHealthy: 1}
+
+// setLeaderElectionHealthy records whether the leader-election loop is
+// still running; /healthz reports unhealthy once this flips false (e.g.
+// the loop exited unexpectedly).
+func setLeaderElectionHealthy(healthy bool) {
+	atomic.StoreInt32(&health.leaderElectionHealthy, boolToInt32(healthy))
+}
+
+// setLeaderHealthy records whether this replica currently holds the
+// leader-election lease; /readyz reports unready once this flips false.
+func setLeaderHealthy(isLeader bool) {
+	atomic.StoreInt32(&health.isLeader, boolToInt32(isLeader))
+}
+
+// setCachesSynced records whether every informer cache this operator
+// depends on has completed its initial sync.
+func setCachesSynced(synced bool) {
+	atomic.StoreInt32(&health.cachesSynced, boolToInt32(synced))
+}
+
+// recordReconcile marks that a reconcile just completed successfully, so
+// /readyz can detect a stalled workqueue.
+func recordReconcile(now time.Time) {
+	atomic.StoreInt64(&health.lastReconcileUnix, now.Unix())
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// waitForCacheSyncs blocks until every factory's caches have synced (or
+// stopCh closes first), recording the outcome via setCachesSynced so
+// /readyz can gate on it. Each syncFunc matches the signature of a shared
+// informer factory's WaitForCacheSync method.
+func waitForCacheSyncs(stopCh <-chan struct{}, syncFuncs ...func(<-chan struct{}) map[reflect.Type]bool) bool {
+	for _, waitForSync := range syncFuncs {
+		for informerType, synced := range waitForSync(stopCh) {
+			if !synced {
+				klog.Errorf("timed out waiting for %v informer cache to sync", informerType)
+				setCachesSynced(false)
+				return false
+			}
+		}
+	}
+	setCachesSynced(true)
+	recordReconcile(time.Now())
+	return true
+}
+
+// startHealthServer serves /healthz and /readyz on --health-addr until
+// stopCh is closed, at which point it shuts down cleanly. /healthz reports
+// 200 as long as the process is alive and the leader-election loop hasn't
+// reported unhealthy. /readyz reports 200 only once the informer caches
+// have synced, and flips back to 503 if the lease is lost or the
+// workqueue stalls for longer than --reconcile-stall-window.
+func startHealthServer(stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&health.leaderElectionHealthy) == 0 {
+			http.Error(w, "leader election unhealthy", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&health.cachesSynced) == 0 {
+			http.Error(w, "informer caches not synced", http.StatusServiceUnavailable)
+			return
+		}
+		if atomic.LoadInt32(&health.isLeader) == 0 {
+			http.Error(w, "not leader", http.StatusServiceUnavailable)
+			return
+		}
+		last := atomic.LoadInt64(&health.lastReconcileUnix)
+		if last != 0 && time.Since(time.Unix(last, 0)) > *reconcileStallWindow {
+			http.Error(w, "workqueue stalled", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv := &http.Server{Addr: *healthAddr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.Errorf("health server exited with error: %v", err)
+		}
+	}()
+
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			klog.Errorf("error shutting down health server: %v", err)
+		}
+	}()
+}
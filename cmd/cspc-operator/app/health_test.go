@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWaitForCacheSyncs(t *testing.T) {
+	synced := func(stopCh <-chan struct{}) map[reflect.Type]bool {
+		return map[reflect.Type]bool{reflect.TypeOf(0): true}
+	}
+	notSynced := func(stopCh <-chan struct{}) map[reflect.Type]bool {
+		return map[reflect.Type]bool{reflect.TypeOf(""): false}
+	}
+
+	tests := map[string]struct {
+		syncFuncs        []func(<-chan struct{}) map[reflect.Type]bool
+		want             bool
+		wantCachesSynced int32
+	}{
+		"every factory synced returns true and records a reconcile": {
+			syncFuncs:        []func(<-chan struct{}) map[reflect.Type]bool{synced, synced},
+			want:             true,
+			wantCachesSynced: 1,
+		},
+		"one factory failing to sync returns false": {
+			syncFuncs:        []func(<-chan struct{}) map[reflect.Type]bool{synced, notSynced},
+			want:             false,
+			wantCachesSynced: 0,
+		},
+		"no factories configured trivially succeeds": {
+			syncFuncs:        nil,
+			want:             true,
+			wantCachesSynced: 1,
+		},
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			atomic.StoreInt32(&health.cachesSynced, 0)
+			atomic.StoreInt64(&health.lastReconcileUnix, 0)
+
+			got := waitForCacheSyncs(stopCh, tt.syncFuncs...)
+			if got != tt.want {
+				t.Errorf("waitForCacheSyncs() = %v, want %v", got, tt.want)
+			}
+			if gotSynced := atomic.LoadInt32(&health.cachesSynced); gotSynced != tt.wantCachesSynced {
+				t.Errorf("health.cachesSynced = %d, want %d", gotSynced, tt.wantCachesSynced)
+			}
+			if tt.want && atomic.LoadInt64(&health.lastReconcileUnix) == 0 {
+				t.Error("waitForCacheSyncs() succeeded but did not record a reconcile timestamp")
+			}
+		})
+	}
+}
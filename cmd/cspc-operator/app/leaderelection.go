@@ -0,0 +1,247 @@
+/*
+Copyright 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+)
+
+var (
+	leaseDuration = flag.Duration("lease-duration", getDurationFromEnv("LEASE_DURATION", 15*time.Second),
+		"Duration that non-leader candidates will wait to force acquire leadership")
+	renewDeadline = flag.Duration("renew-deadline", getDurationFromEnv("RENEW_DEADLINE", 10*time.Second),
+		"Duration that the leader will retry refreshing leadership before giving it up")
+	retryPeriod = flag.Duration("retry-period", getDurationFromEnv("RETRY_PERIOD", 2*time.Second),
+		"Duration the LeaderElector clients should wait between tries of actions")
+	leaderElectionNamespace = flag.String("leader-election-namespace", getStringFromEnv("LEADER_ELECTION_NAMESPACE", "kube-system"),
+		"Namespace in which the leader election Lease object is created")
+	leaderElectionLockName = flag.String("leader-election-lock-name", getStringFromEnv("LEADER_ELECTION_LOCK_NAME", "cstor-operator-leader-election"),
+		"Name of the Lease object used to coordinate leader election")
+)
+
+// getDurationFromEnv returns the duration parsed from the seconds value
+// stored in the given environment variable, or def if the env var is
+// missing or cannot be parsed.
+func getDurationFromEnv(envName string, def time.Duration) time.Duration {
+	v := os.Getenv(envName)
+	if v == "" {
+		return def
+	}
+	seconds, err := strconv.Atoi(v)
+	if err != nil || seconds == 0 {
+		klog.Warningf("Incorrect value %q for %s, defaulting to %s", v, envName, def)
+		return def
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// getStringFromEnv returns the value of the given environment variable, or
+// def if it is unset.
+func getStringFromEnv(envName string, def string) string {
+	if v := os.Getenv(envName); v != "" {
+		return v
+	}
+	return def
+}
+
+// leaderRunSession tracks the stop/done channels for one
+// OnStartedLeading/OnStoppedLeading cycle, so OnStoppedLeading (and the
+// final shutdown path below) can signal run() to stop and wait for it to
+// actually return, without racing a later cycle's channels.
+type leaderRunSession struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// runWithLeaderElection wraps run so that it only executes while this
+// process holds the leader Lease. It blocks until stopCh is closed and the
+// leader election loop has actually exited.
+//
+// le.Run is given a context derived from stopCh instead of
+// context.Background(): le.Run returns as soon as a single acquire/renew
+// cycle ends, whether that's because stopCh closed or because a lease
+// renewal merely failed transiently, so it's called in a loop and only
+// treated as a real shutdown once ctx.Err() is non-nil. Once the loop has
+// exited — and only then, so there is no longer a renew loop touching the
+// same resourcelock.Interface concurrently — this waits for the most recent
+// run() invocation to finish (not just for it to be told to stop) before
+// explicitly clearing the lease to emulate the Kubernetes 1.14
+// graceful-release behaviour (holderIdentity emptied, acquireTime/renewTime
+// zeroed) so a standby replica picks up work immediately instead of
+// waiting out the full lease TTL.
+func runWithLeaderElection(kubeClient kubernetes.Interface, recorder record.EventRecorder, id string, run func(stopCh <-chan struct{}), stopCh <-chan struct{}) error {
+	rl, err := newLeaseLock(kubeClient, recorder, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to create leader election resource lock")
+	}
+
+	var (
+		mtx       sync.Mutex
+		session   *leaderRunSession
+		wasLeader int32
+	)
+
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          rl,
+		LeaseDuration: *leaseDuration,
+		RenewDeadline: *renewDeadline,
+		RetryPeriod:   *retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(_ context.Context) {
+				atomic.StoreInt32(&wasLeader, 1)
+				setLeaderHealthy(true)
+
+				s := &leaderRunSession{stop: make(chan struct{}), done: make(chan struct{})}
+				mtx.Lock()
+				session = s
+				mtx.Unlock()
+
+				run(s.stop)
+				close(s.done)
+			},
+			OnStoppedLeading: func() {
+				setLeaderHealthy(false)
+
+				mtx.Lock()
+				s := session
+				mtx.Unlock()
+				if s != nil {
+					s.once.Do(func() { close(s.stop) })
+				}
+
+				klog.Infof("%s stopped leading", id)
+			},
+			OnNewLeader: func(identity string) {
+				if identity == id {
+					return
+				}
+				klog.Infof("new leader elected: %s", identity)
+			},
+		},
+		// The release is performed manually below, strictly after the loop
+		// below exits, so ReleaseOnCancel is left off here to avoid
+		// releasing the lease twice.
+		ReleaseOnCancel: false,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create leader elector")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	for ctx.Err() == nil {
+		le.Run(ctx)
+	}
+
+	mtx.Lock()
+	s := session
+	mtx.Unlock()
+	if s != nil {
+		s.once.Do(func() { close(s.stop) })
+		<-s.done
+	}
+
+	if atomic.LoadInt32(&wasLeader) == 1 {
+		releaseLease(rl)
+	}
+	setLeaderElectionHealthy(false)
+	return nil
+}
+
+// newLeaseLock builds the Lease-based resource lock used to coordinate
+// leader election across cstor-operator replicas.
+func newLeaseLock(kubeClient kubernetes.Interface, recorder record.EventRecorder, id string) (resourcelock.Interface, error) {
+	return resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		*leaderElectionNamespace,
+		*leaderElectionLockName,
+		kubeClient.CoreV1(),
+		kubeClient.CoordinationV1(),
+		resourcelock.ResourceLockConfig{
+			Identity:      id,
+			EventRecorder: recorder,
+		},
+	)
+}
+
+// releaseLease emulates the Kubernetes 1.14 graceful leader-release
+// behaviour: it clears the Lease's holderIdentity and zeroes its
+// acquireTime/renewTime so that the next standby replica acquires
+// leadership immediately instead of waiting for the full lease TTL to
+// expire.
+func releaseLease(rl resourcelock.Interface) {
+	klog.Infof("releasing lease %s before shutdown", rl.Describe())
+
+	now := metav1.NewTime(time.Time{})
+	err := rl.Update(context.Background(), resourcelock.LeaderElectionRecord{
+		HolderIdentity:       "",
+		LeaseDurationSeconds: int(leaseDuration.Seconds()),
+		AcquireTime:          now,
+		RenewTime:            now,
+	})
+	if err != nil {
+		klog.Errorf("failed to release lease gracefully: %v", err)
+	}
+}
+
+// newEventRecorder builds the single broadcaster-backed recorder shared by
+// the controller and leader election, so events from both are sinked
+// through one broadcaster under one Component label instead of two
+// independently-logging recorders.
+func newEventRecorder(kubeClient kubernetes.Interface, component string) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(func(format string, args ...interface{}) {
+		klog.Infof(format, args...)
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: kubeClient.CoreV1().Events(""),
+	})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component})
+}
+
+// operatorIdentity builds the identity string used to tag the Lease holder.
+func operatorIdentity() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get hostname")
+	}
+	return fmt.Sprintf("%s_%d", hostname, os.Getpid()), nil
+}
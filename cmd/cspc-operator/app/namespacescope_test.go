@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWatchNamespaces(t *testing.T) {
+	tests := map[string]struct {
+		flagValue string
+		want      []string
+	}{
+		"empty flag watches the whole cluster": {
+			flagValue: "",
+			want:      nil,
+		},
+		"single namespace": {
+			flagValue: "openebs",
+			want:      []string{"openebs"},
+		},
+		"multiple namespaces": {
+			flagValue: "openebs,default",
+			want:      []string{"openebs", "default"},
+		},
+		"whitespace around namespaces is trimmed": {
+			flagValue: " openebs , default ",
+			want:      []string{"openebs", "default"},
+		},
+		"empty entries between commas are dropped": {
+			flagValue: "openebs,,default,",
+			want:      []string{"openebs", "default"},
+		},
+		"only commas and whitespace watches the whole cluster": {
+			flagValue: " , , ",
+			want:      nil,
+		},
+	}
+
+	original := *watchNamespaces
+	defer func() { *watchNamespaces = original }()
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			*watchNamespaces = tt.flagValue
+			got := parseWatchNamespaces()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWatchNamespaces() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"flag"
+	"os"
+	"strconv"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+)
+
+const (
+	// minThreadiness and maxThreadiness bound the --threadiness flag to a
+	// sane range so a typo doesn't spin up an unreasonable number of
+	// workers or leave the controller unable to make progress.
+	minThreadiness = 1
+	maxThreadiness = 50
+
+	// defaultThreadiness matches the hard-coded value the controller used
+	// to run with before --threadiness was configurable.
+	defaultThreadiness = 2
+)
+
+var (
+	rateLimiterType = flag.String("rate-limiter", getStringFromEnv("RATE_LIMITER_TYPE", "composite"),
+		`Workqueue rate limiter to use: "exponential", "bitrate", or "composite" (per-key exponential backoff combined with an overall bucket rate limit)`)
+	rateLimiterBaseDelay = flag.Duration("rate-limiter-base-delay", getDurationFromEnv("RATE_LIMITER_BASE_DELAY", workqueue.DefaultControllerBaseDelay),
+		"Base retry delay for the exponential failure rate limiter")
+	rateLimiterMaxDelay = flag.Duration("rate-limiter-max-delay", getDurationFromEnv("RATE_LIMITER_MAX_DELAY", workqueue.DefaultControllerMaxDelay),
+		"Maximum retry delay for the exponential failure rate limiter")
+	rateLimiterQPS   = flag.Float64("rate-limiter-qps", 10, "Average overall QPS, shared by all keys, allowed by the bucket rate limiter")
+	rateLimiterBurst = flag.Int("rate-limiter-burst", 100, "Burst size allowed by the bucket rate limiter")
+	threadiness      = flag.Int("threadiness", getIntFromEnv("THREADINESS", defaultThreadiness),
+		"Number of workers to launch to process the CSPC workqueue")
+)
+
+// getIntFromEnv returns the integer value of the given environment
+// variable, or def if it is unset or cannot be parsed.
+func getIntFromEnv(envName string, def int) int {
+	v := os.Getenv(envName)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		klog.Warningf("Incorrect value %q for %s, defaulting to %d", v, envName, def)
+		return def
+	}
+	return n
+}
+
+// newWorkqueueRateLimiter builds the workqueue.RateLimiter selected by
+// --rate-limiter/RATE_LIMITER_TYPE, giving operators a supported way to
+// tune reconciliation aggressiveness on large clusters instead of forking
+// the code.
+func newWorkqueueRateLimiter() workqueue.RateLimiter {
+	exponential := workqueue.NewItemExponentialFailureRateLimiter(*rateLimiterBaseDelay, *rateLimiterMaxDelay)
+	bitrate := &workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(*rateLimiterQPS), *rateLimiterBurst)}
+
+	switch *rateLimiterType {
+	case "exponential":
+		return exponential
+	case "bitrate":
+		return bitrate
+	case "composite":
+		return workqueue.NewMaxOfRateLimiter(exponential, bitrate)
+	default:
+		klog.Warningf("Unknown rate limiter %q, defaulting to composite", *rateLimiterType)
+		return workqueue.NewMaxOfRateLimiter(exponential, bitrate)
+	}
+}
+
+// getThreadiness returns --threadiness/THREADINESS when it lies within
+// [minThreadiness, maxThreadiness], and defaultThreadiness otherwise.
+func getThreadiness() int {
+	if *threadiness < minThreadiness || *threadiness > maxThreadiness {
+		klog.Warningf("threadiness %d out of range [%d, %d], defaulting to %d", *threadiness, minThreadiness, maxThreadiness, defaultThreadiness)
+		return defaultThreadiness
+	}
+	return *threadiness
+}
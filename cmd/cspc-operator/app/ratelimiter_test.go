@@ -0,0 +1,113 @@
+/*
+Copyright 2019 The OpenEBS Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"testing"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestGetThreadiness(t *testing.T) {
+	tests := map[string]struct {
+		flagValue int
+		want      int
+	}{
+		"within range is returned unchanged": {
+			flagValue: 5,
+			want:      5,
+		},
+		"lower bound is returned unchanged": {
+			flagValue: minThreadiness,
+			want:      minThreadiness,
+		},
+		"upper bound is returned unchanged": {
+			flagValue: maxThreadiness,
+			want:      maxThreadiness,
+		},
+		"below minimum falls back to the default": {
+			flagValue: minThreadiness - 1,
+			want:      defaultThreadiness,
+		},
+		"above maximum falls back to the default": {
+			flagValue: maxThreadiness + 1,
+			want:      defaultThreadiness,
+		},
+	}
+
+	original := *threadiness
+	defer func() { *threadiness = original }()
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			*threadiness = tt.flagValue
+			if got := getThreadiness(); got != tt.want {
+				t.Errorf("getThreadiness() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewWorkqueueRateLimiter(t *testing.T) {
+	tests := map[string]struct {
+		flagValue string
+		wantType  string
+	}{
+		"exponential selects the exponential failure rate limiter": {
+			flagValue: "exponential",
+			wantType:  "*workqueue.ItemExponentialFailureRateLimiter",
+		},
+		"bitrate selects the bucket rate limiter": {
+			flagValue: "bitrate",
+			wantType:  "*workqueue.BucketRateLimiter",
+		},
+		"composite selects the combined rate limiter": {
+			flagValue: "composite",
+			wantType:  "*workqueue.MaxOfRateLimiter",
+		},
+		"unknown value falls back to composite": {
+			flagValue: "made-up",
+			wantType:  "*workqueue.MaxOfRateLimiter",
+		},
+	}
+
+	original := *rateLimiterType
+	defer func() { *rateLimiterType = original }()
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			*rateLimiterType = tt.flagValue
+			got := newWorkqueueRateLimiter()
+
+			var gotType string
+			switch got.(type) {
+			case *workqueue.ItemExponentialFailureRateLimiter:
+				gotType = "*workqueue.ItemExponentialFailureRateLimiter"
+			case *workqueue.BucketRateLimiter:
+				gotType = "*workqueue.BucketRateLimiter"
+			case *workqueue.MaxOfRateLimiter:
+				gotType = "*workqueue.MaxOfRateLimiter"
+			default:
+				t.Fatalf("newWorkqueueRateLimiter() returned unexpected type %T", got)
+			}
+
+			if gotType != tt.wantType {
+				t.Errorf("newWorkqueueRateLimiter() returned %s, want %s", gotType, tt.wantType)
+			}
+		})
+	}
+}
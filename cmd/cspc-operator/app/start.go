@@ -19,6 +19,7 @@ package app
 import (
 	"flag"
 	"os"
+	"reflect"
 	"strconv"
 	"time"
 
@@ -26,7 +27,6 @@ import (
 	"k8s.io/klog"
 
 	clientset "github.com/openebs/maya/pkg/client/generated/clientset/versioned"
-	informers "github.com/openebs/maya/pkg/client/generated/informers/externalversions"
 	ndmclientset "github.com/openebs/maya/pkg/client/generated/openebs.io/ndm/v1alpha1/clientset/internalclientset"
 	"github.com/openebs/maya/pkg/signals"
 	kubeinformers "k8s.io/client-go/informers"
@@ -79,7 +79,9 @@ func Start() error {
 	}
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, getSyncInterval())
-	spcInformerFactory := informers.NewSharedInformerFactory(openebsClient, getSyncInterval())
+	// spcInformerFactories holds one factory per watched namespace, or a
+	// single cluster-wide factory when --watch-namespaces is unset.
+	spcInformerFactories := newSPCInformerFactories(openebsClient, getSyncInterval())
 	// Build() fn of all controllers calls AddToScheme to adds all types of this
 	// clientset into the given scheme.
 	// If multiple controllers happen to call this AddToScheme same time,
@@ -87,15 +89,34 @@ func Start() error {
 	// This lock is used to serialize the AddToScheme call of all controllers.
 	//controllerMtx.Lock()
 
-	controller, err := NewControllerBuilder().
+	// dynamicInformers lets the controller lazily start informers for GVRs
+	// discovered at runtime (e.g. BlockDeviceClaim, custom pool policies, or
+	// third-party CRs referenced by a CSPC's spec) without recompiling the
+	// operator.
+	dynamicInformers, err := newDynamicInformerManager(cfg, getSyncInterval(), stopCh)
+	if err != nil {
+		return errors.Wrap(err, "error building dynamic informer factory")
+	}
+
+	// recorder is shared between the controller and leader election so
+	// events from both are sinked through one broadcaster under one
+	// Component label instead of two independently-logging recorders.
+	recorder := newEventRecorder(kubeClient, "cstor-operator")
+
+	builder := NewControllerBuilder().
 		withKubeClient(kubeClient).
 		withOpenEBSClient(openebsClient).
 		withNDMClient(ndmClient).
-		withCSPCSynced(spcInformerFactory).
-		withCSPCLister(spcInformerFactory).
-		withRecorder(kubeClient).
-		withEventHandler(spcInformerFactory).
-		withWorkqueueRateLimiting().Build()
+		withRecorder(recorder).
+		withDynamicInformerFactory(dynamicInformers)
+	for _, spcInformerFactory := range spcInformerFactories {
+		builder = builder.
+			withCSPCSynced(spcInformerFactory).
+			withCSPCLister(spcInformerFactory).
+			withEventHandler(spcInformerFactory)
+	}
+	controller, err := builder.
+		withWorkqueueRateLimiting(newWorkqueueRateLimiter()).Build()
 
 	// blocking call, can't use defer to release the lock
 	//controllerMtx.Unlock()
@@ -104,11 +125,36 @@ func Start() error {
 		return errors.Wrapf(err, "error building controller instance")
 	}
 
-	go kubeInformerFactory.Start(stopCh)
-	go spcInformerFactory.Start(stopCh)
+	id, err := operatorIdentity()
+	if err != nil {
+		return errors.Wrap(err, "error determining operator identity for leader election")
+	}
+
+	startMetricsServer(stopCh)
+	startHealthServer(stopCh)
+
+	run := func(leaderStopCh <-chan struct{}) {
+		setLeaderElectionState(true)
+		defer setLeaderElectionState(false)
+
+		go kubeInformerFactory.Start(leaderStopCh)
+		startSPCInformerFactories(spcInformerFactories, leaderStopCh)
+
+		syncFuncs := []func(<-chan struct{}) map[reflect.Type]bool{kubeInformerFactory.WaitForCacheSync}
+		for _, spcInformerFactory := range spcInformerFactories {
+			syncFuncs = append(syncFuncs, spcInformerFactory.WaitForCacheSync)
+		}
+		if !waitForCacheSyncs(leaderStopCh, syncFuncs...) {
+			return
+		}
+
+		// Threadiness defines the number of workers to be launched in Run function
+		if err := controller.Run(getThreadiness(), leaderStopCh); err != nil {
+			klog.Errorf("controller exited with error: %v", err)
+		}
+	}
 
-	// Threadiness defines the number of workers to be launched in Run function
-	return controller.Run(2, stopCh)
+	return runWithLeaderElection(kubeClient, recorder, id, run, stopCh)
 }
 
 // GetClusterConfig return the config for k8s.